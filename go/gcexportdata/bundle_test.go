@@ -0,0 +1,125 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcexportdata
+
+import (
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+// typecheckNamed is like typecheck but lets the caller pick the
+// package's import path, so that distinct packages can be combined
+// into a single bundle.
+func typecheckNamed(t *testing.T, name, src string) *types.Package {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, name+".go", "package "+name+"\n"+src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: importer.Default()}
+	pkg, err := conf.Check(name, fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
+
+func TestWriteReadBundle(t *testing.T) {
+	pkgA := typecheckNamed(t, "a", `type A struct{ X int }`)
+	pkgB := typecheckNamed(t, "b", `type B struct{ Y string }`)
+
+	fset := token.NewFileSet()
+	var buf bytes.Buffer
+	if err := WriteBundle(&buf, fset, []*types.Package{pkgA, pkgB}); err != nil {
+		t.Fatalf("WriteBundle: %v", err)
+	}
+
+	got, err := ReadBundle(&buf, fset, make(map[string]*types.Package))
+	if err != nil {
+		t.Fatalf("ReadBundle: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("ReadBundle returned %d packages, want 2", len(got))
+	}
+	for i, want := range []*types.Package{pkgA, pkgB} {
+		if got[i].Path() != want.Path() {
+			t.Errorf("package %d: path = %q, want %q", i, got[i].Path(), want.Path())
+		}
+	}
+}
+
+// fixedImporter resolves one specific import path to a fixed package,
+// falling back to importer.Default() for anything else, so a test can
+// make one typechecked package import another.
+type fixedImporter struct {
+	pkg *types.Package
+}
+
+func (i fixedImporter) Import(path string) (*types.Package, error) {
+	if path == i.pkg.Path() {
+		return i.pkg, nil
+	}
+	return importer.Default().Import(path)
+}
+
+// TestWriteReadBundleTransitiveClosure checks that WriteBundle pulls
+// in a package's imports even when only the importing package is
+// passed in, and that ReadBundle reconstructs the whole closure in
+// dependency order, as documented on WriteBundle.
+func TestWriteReadBundleTransitiveClosure(t *testing.T) {
+	pkgB := typecheckNamed(t, "b", `type B struct{ Y string }`)
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "a.go", `package a
+import "b"
+type A struct{ Val b.B }
+`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: fixedImporter{pkgB}}
+	pkgA, err := conf.Check("a", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteBundle(&buf, fset, []*types.Package{pkgA}); err != nil {
+		t.Fatalf("WriteBundle: %v", err)
+	}
+
+	got, err := ReadBundle(&buf, fset, make(map[string]*types.Package))
+	if err != nil {
+		t.Fatalf("ReadBundle: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("ReadBundle returned %d packages, want 2 (b pulled in by a)", len(got))
+	}
+	if got[0].Path() != "b" || got[1].Path() != "a" {
+		t.Errorf("ReadBundle order = %q, %q, want %q, %q (dependency order)", got[0].Path(), got[1].Path(), "b", "a")
+	}
+}
+
+func TestWriteBundleDetectsImportCycle(t *testing.T) {
+	a := types.NewPackage("a", "a")
+	b := types.NewPackage("b", "b")
+	a.SetImports([]*types.Package{b})
+	b.SetImports([]*types.Package{a})
+	a.MarkComplete()
+	b.MarkComplete()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("WriteBundle did not panic on an import cycle")
+		}
+	}()
+	WriteBundle(new(bytes.Buffer), token.NewFileSet(), []*types.Package{a, b})
+}
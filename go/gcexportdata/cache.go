@@ -0,0 +1,107 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcexportdata
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// A CacheKey identifies a single decoding of an export data file, so
+// that a Cache can tell whether a previously cached package is still
+// valid for the file currently on disk.
+type CacheKey struct {
+	Path    string    // resolved (canonical) import path
+	ModTime time.Time // modification time of the object/archive file
+	Size    int64     // size in bytes of the object/archive file
+}
+
+// A Cache stores the encoded export data for packages already decoded
+// by an Importer returned by NewImporter, keyed by CacheKey, so that a
+// later import of the same package can skip re-parsing the compiler
+// object file. Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the previously stored data for key, if any.
+	Get(key CacheKey) (data []byte, ok bool)
+
+	// Put stores data for key, for later retrieval by Get.
+	Put(key CacheKey, data []byte)
+}
+
+// NewCache returns a Cache that holds its entries in memory for the
+// lifetime of the process.
+func NewCache() Cache {
+	return &memCache{m: make(map[CacheKey][]byte)}
+}
+
+type memCache struct {
+	mu sync.Mutex
+	m  map[CacheKey][]byte
+}
+
+func (c *memCache) Get(key CacheKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.m[key]
+	return data, ok
+}
+
+func (c *memCache) Put(key CacheKey, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m[key] = data
+}
+
+// DiskCache returns a Cache that persists entries as files beneath
+// dir, so that decoded packages survive across process restarts. dir
+// is created on first use if it does not already exist.
+func DiskCache(dir string) Cache {
+	return &diskCache{dir: dir}
+}
+
+type diskCache struct {
+	dir string
+}
+
+func (c *diskCache) filename(key CacheKey) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s@%d@%d", key.Path, key.ModTime.UnixNano(), key.Size)))
+	return filepath.Join(c.dir, fmt.Sprintf("%x.gcx", h))
+}
+
+func (c *diskCache) Get(key CacheKey) ([]byte, bool) {
+	data, err := ioutil.ReadFile(c.filename(key))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+func (c *diskCache) Put(key CacheKey, data []byte) {
+	if err := os.MkdirAll(c.dir, 0777); err != nil {
+		return
+	}
+	// Write to a temporary file and rename it into place, so that a
+	// reader never observes a partially written entry: a process that
+	// crashes or is killed mid-write leaves only the temp file behind,
+	// never a file at filename(key) with truncated contents.
+	tmp, err := ioutil.TempFile(c.dir, "tmp-*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name()) // no-op once the rename below succeeds
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		return
+	}
+	_ = os.Rename(tmp.Name(), c.filename(key))
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcexportdata
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func testCacheHitAndMiss(t *testing.T, c Cache) {
+	t.Helper()
+	key := CacheKey{Path: "example.com/p", ModTime: time.Unix(100, 0), Size: 42}
+
+	if _, ok := c.Get(key); ok {
+		t.Fatal("Get on an empty cache returned ok=true")
+	}
+
+	c.Put(key, []byte("hello"))
+	data, ok := c.Get(key)
+	if !ok || string(data) != "hello" {
+		t.Fatalf("Get after Put = %q, %v, want %q, true", data, ok, "hello")
+	}
+
+	other := key
+	other.Size++
+	if _, ok := c.Get(other); ok {
+		t.Fatal("Get with a different CacheKey returned ok=true")
+	}
+}
+
+func TestMemCache(t *testing.T) {
+	testCacheHitAndMiss(t, NewCache())
+}
+
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	testCacheHitAndMiss(t, DiskCache(dir))
+
+	// A second DiskCache rooted at the same directory should see
+	// entries written by the first, since on-disk entries are meant
+	// to survive across process restarts.
+	key := CacheKey{Path: "example.com/q", ModTime: time.Unix(200, 0), Size: 7}
+	DiskCache(dir).Put(key, []byte("world"))
+	data, ok := DiskCache(dir).Get(key)
+	if !ok || string(data) != "world" {
+		t.Fatalf("Get via a second DiskCache = %q, %v, want %q, true", data, ok, "world")
+	}
+}
+
+// TestDiskCachePutHeals checks that a second Put for a key already
+// holding bad (e.g. undecodable) data replaces it, which is what lets
+// an Importer heal a poisoned cache entry after falling back to the
+// object file and re-encoding it.
+func TestDiskCachePutHeals(t *testing.T) {
+	dir := t.TempDir()
+	c := DiskCache(dir)
+	key := CacheKey{Path: "example.com/r", ModTime: time.Unix(300, 0), Size: 3}
+
+	c.Put(key, []byte("bad"))
+	c.Put(key, []byte("good"))
+
+	data, ok := c.Get(key)
+	if !ok || string(data) != "good" {
+		t.Fatalf("Get after healing Put = %q, %v, want %q, true", data, ok, "good")
+	}
+}
+
+// TestDiskCachePutLeavesNoTempFiles checks that Put's temp-file-then-
+// rename write strategy doesn't leak its temporary file into dir.
+func TestDiskCachePutLeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	key := CacheKey{Path: "example.com/s", ModTime: time.Unix(400, 0), Size: 5}
+	DiskCache(dir).Put(key, []byte("hello"))
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("dir contains %d entries after Put, want 1: %v", len(entries), entries)
+	}
+}
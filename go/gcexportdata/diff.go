@@ -0,0 +1,564 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcexportdata
+
+import (
+	"fmt"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"os"
+)
+
+// A ChangeKind describes how an exported API element differs between
+// two versions of a package.
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota
+	Removed
+	Changed
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	default:
+		return "unknown"
+	}
+}
+
+// A Severity classifies a Change according to the Go 1 compatibility
+// guidelines: whether it can break code that already imports the
+// package (Breaking), or can only extend what such code may do
+// (Additive).
+type Severity int
+
+const (
+	Additive Severity = iota
+	Breaking
+)
+
+func (s Severity) String() string {
+	if s == Breaking {
+		return "breaking"
+	}
+	return "additive"
+}
+
+// A Change describes the addition, removal, or modification of a
+// single exported object (a func, type, const, var, method of an
+// interface or a concrete type, or field of a struct type) between two
+// versions of a package, as reported by Diff.
+type Change struct {
+	Object   string // qualified name, e.g. "Foo", "Foo.Method" or "Foo.Field"
+	Kind     ChangeKind
+	Severity Severity
+	Message  string // human-readable description
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s (%s)", c.Object, c.Message, c.Severity)
+}
+
+// Diff compares the exported API of old and new, the same package at
+// two different points in time, and reports every addition, removal,
+// and modification of an exported func, type, const, or var, together
+// with its Severity under the Go 1 compatibility guidelines: adding an
+// exported identifier, a method on a concrete type, or a field to a
+// struct that already has an unexported field, is Additive; removing
+// an identifier, changing a func signature or a constant's value,
+// changing a struct field's type, removing or changing the signature
+// of a method on a concrete type, or changing an interface's method
+// set (in either direction), is Breaking.
+//
+// Diff does not compare unexported parts of the API, and it does not
+// detect changes in behavior that preserve the API's shape.
+func Diff(old, new *types.Package) []Change {
+	var changes []Change
+
+	oldScope, newScope := old.Scope(), new.Scope()
+	for _, name := range oldScope.Names() {
+		if !token.IsExported(name) {
+			continue
+		}
+		oldObj := oldScope.Lookup(name)
+		newObj := newScope.Lookup(name)
+		if newObj == nil {
+			changes = append(changes, Change{
+				Object:   name,
+				Kind:     Removed,
+				Severity: Breaking,
+				Message:  fmt.Sprintf("%s removed", describe(oldObj)),
+			})
+			continue
+		}
+		changes = append(changes, diffObject(name, oldObj, newObj)...)
+	}
+	for _, name := range newScope.Names() {
+		if !token.IsExported(name) {
+			continue
+		}
+		if oldScope.Lookup(name) == nil {
+			newObj := newScope.Lookup(name)
+			changes = append(changes, Change{
+				Object:   name,
+				Kind:     Added,
+				Severity: Additive,
+				Message:  fmt.Sprintf("%s added", describe(newObj)),
+			})
+		}
+	}
+	return changes
+}
+
+// DiffFiles is a convenience wrapper around Diff that locates and
+// decodes the export data for oldPath and newPath using Find and
+// Read.
+func DiffFiles(oldPath, newPath string) ([]Change, error) {
+	oldPkg, err := readExportedPackage(oldPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading %q: %v", oldPath, err)
+	}
+	newPkg, err := readExportedPackage(newPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading %q: %v", newPath, err)
+	}
+	return Diff(oldPkg, newPkg), nil
+}
+
+func readExportedPackage(importPath string) (*types.Package, error) {
+	filename, resolved := Find(importPath, "")
+	if filename == "" {
+		return nil, fmt.Errorf("can't find import: %q", importPath)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	return Read(r, token.NewFileSet(), make(map[string]*types.Package), resolved)
+}
+
+// diffObject compares two same-named objects from successive
+// versions of a package and reports any Change between them.
+func diffObject(name string, oldObj, newObj types.Object) []Change {
+	switch old := oldObj.(type) {
+	case *types.Func:
+		new, ok := newObj.(*types.Func)
+		if !ok {
+			return []Change{kindChanged(name, oldObj, newObj)}
+		}
+		if !equivalentTypes(old.Type(), new.Type()) {
+			return []Change{{
+				Object:   name,
+				Kind:     Changed,
+				Severity: Breaking,
+				Message:  fmt.Sprintf("signature changed from %s to %s", old.Type(), new.Type()),
+			}}
+		}
+	case *types.Const:
+		new, ok := newObj.(*types.Const)
+		if !ok {
+			return []Change{kindChanged(name, oldObj, newObj)}
+		}
+		if !equivalentTypes(old.Type(), new.Type()) {
+			return []Change{{
+				Object:   name,
+				Kind:     Changed,
+				Severity: Breaking,
+				Message:  fmt.Sprintf("type changed from %s to %s", old.Type(), new.Type()),
+			}}
+		}
+		if !constant.Compare(old.Val(), token.EQL, new.Val()) {
+			return []Change{{
+				Object:   name,
+				Kind:     Changed,
+				Severity: Breaking,
+				Message:  fmt.Sprintf("value changed from %s to %s", old.Val(), new.Val()),
+			}}
+		}
+	case *types.Var:
+		new, ok := newObj.(*types.Var)
+		if !ok {
+			return []Change{kindChanged(name, oldObj, newObj)}
+		}
+		if !equivalentTypes(old.Type(), new.Type()) {
+			return []Change{{
+				Object:   name,
+				Kind:     Changed,
+				Severity: Breaking,
+				Message:  fmt.Sprintf("type changed from %s to %s", old.Type(), new.Type()),
+			}}
+		}
+	case *types.TypeName:
+		new, ok := newObj.(*types.TypeName)
+		if !ok {
+			return []Change{kindChanged(name, oldObj, newObj)}
+		}
+		return diffType(name, old, new)
+	}
+	return nil
+}
+
+// diffType compares the underlying types and the explicitly declared
+// method sets of two versions of an exported named type and reports
+// any Change between them.
+func diffType(name string, old, new *types.TypeName) []Change {
+	var changes []Change
+	if oldNamed, ok := old.Type().(*types.Named); ok {
+		if newNamed, ok := new.Type().(*types.Named); ok {
+			changes = append(changes, diffMethods(name, oldNamed, newNamed)...)
+		}
+	}
+
+	oldUnder, newUnder := old.Type().Underlying(), new.Type().Underlying()
+
+	switch oldIface := oldUnder.(type) {
+	case *types.Interface:
+		newIface, ok := newUnder.(*types.Interface)
+		if !ok {
+			return append(changes, Change{
+				Object:   name,
+				Kind:     Changed,
+				Severity: Breaking,
+				Message:  "no longer an interface",
+			})
+		}
+		return append(changes, diffInterface(name, oldIface, newIface)...)
+
+	case *types.Struct:
+		newStruct, ok := newUnder.(*types.Struct)
+		if !ok {
+			return append(changes, Change{
+				Object:   name,
+				Kind:     Changed,
+				Severity: Breaking,
+				Message:  "no longer a struct",
+			})
+		}
+		return append(changes, diffStruct(name, oldIface, newStruct)...)
+	}
+
+	if !equivalentTypes(oldUnder, newUnder) {
+		changes = append(changes, Change{
+			Object:   name,
+			Kind:     Changed,
+			Severity: Breaking,
+			Message:  fmt.Sprintf("underlying type changed from %s to %s", oldUnder, newUnder),
+		})
+	}
+	return changes
+}
+
+// diffMethods compares the explicitly declared method sets of two
+// versions of an exported named type; it does not apply to the
+// methods of an interface type, which diffInterface already covers.
+// Removing a method, or changing its signature, is Breaking, since it
+// can break existing callers; adding one is Additive, since it only
+// extends what callers may do.
+func diffMethods(name string, old, new *types.Named) []Change {
+	oldMethods := namedMethods(old)
+	newMethods := namedMethods(new)
+
+	var changes []Change
+	for mname, oldSig := range oldMethods {
+		newSig, ok := newMethods[mname]
+		if !ok {
+			changes = append(changes, Change{
+				Object:   name + "." + mname,
+				Kind:     Removed,
+				Severity: Breaking,
+				Message:  "method removed",
+			})
+			continue
+		}
+		if !equivalentTypes(oldSig, newSig) {
+			changes = append(changes, Change{
+				Object:   name + "." + mname,
+				Kind:     Changed,
+				Severity: Breaking,
+				Message:  fmt.Sprintf("signature changed from %s to %s", oldSig, newSig),
+			})
+		}
+	}
+	for mname := range newMethods {
+		if _, ok := oldMethods[mname]; !ok {
+			changes = append(changes, Change{
+				Object:   name + "." + mname,
+				Kind:     Added,
+				Severity: Additive,
+				Message:  "method added",
+			})
+		}
+	}
+	return changes
+}
+
+func namedMethods(n *types.Named) map[string]*types.Signature {
+	methods := make(map[string]*types.Signature, n.NumMethods())
+	for i := 0; i < n.NumMethods(); i++ {
+		m := n.Method(i)
+		if m.Exported() {
+			methods[m.Name()] = m.Type().(*types.Signature)
+		}
+	}
+	return methods
+}
+
+// diffInterface compares the method sets of two versions of an
+// exported interface type. Adding or removing a method is Breaking in
+// both directions: adding one can break existing implementations,
+// and removing one can break existing callers.
+func diffInterface(name string, old, new *types.Interface) []Change {
+	oldMethods := interfaceMethods(old)
+	newMethods := interfaceMethods(new)
+
+	var changes []Change
+	for mname, oldSig := range oldMethods {
+		newSig, ok := newMethods[mname]
+		if !ok {
+			changes = append(changes, Change{
+				Object:   name + "." + mname,
+				Kind:     Removed,
+				Severity: Breaking,
+				Message:  "method removed from interface",
+			})
+			continue
+		}
+		if !equivalentTypes(oldSig, newSig) {
+			changes = append(changes, Change{
+				Object:   name + "." + mname,
+				Kind:     Changed,
+				Severity: Breaking,
+				Message:  fmt.Sprintf("signature changed from %s to %s", oldSig, newSig),
+			})
+		}
+	}
+	for mname := range newMethods {
+		if _, ok := oldMethods[mname]; !ok {
+			changes = append(changes, Change{
+				Object:   name + "." + mname,
+				Kind:     Added,
+				Severity: Breaking,
+				Message:  "method added to interface",
+			})
+		}
+	}
+	return changes
+}
+
+func interfaceMethods(iface *types.Interface) map[string]*types.Signature {
+	methods := make(map[string]*types.Signature, iface.NumMethods())
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		if m.Exported() {
+			methods[m.Name()] = m.Type().(*types.Signature)
+		}
+	}
+	return methods
+}
+
+// diffStruct compares the exported fields of two versions of an
+// exported struct type. Per the Go 1 compatibility guidelines, adding
+// a field is Additive once the struct already has an unexported field
+// (which already prevented construction via an external composite
+// literal with all fields named or positioned); otherwise it is
+// Breaking, since it can change the meaning of, or invalidate, an
+// existing positional composite literal.
+func diffStruct(name string, old, new *types.Struct) []Change {
+	addIsBreaking := !hasUnexportedField(old)
+
+	oldFields := structFields(old)
+	newFields := structFields(new)
+
+	var changes []Change
+	for fname, oldField := range oldFields {
+		newField, ok := newFields[fname]
+		if !ok {
+			changes = append(changes, Change{
+				Object:   name + "." + fname,
+				Kind:     Removed,
+				Severity: Breaking,
+				Message:  "field removed from struct",
+			})
+			continue
+		}
+		if !equivalentTypes(oldField, newField) {
+			changes = append(changes, Change{
+				Object:   name + "." + fname,
+				Kind:     Changed,
+				Severity: Breaking,
+				Message:  fmt.Sprintf("field type changed from %s to %s", oldField, newField),
+			})
+		}
+	}
+	for fname := range newFields {
+		if _, ok := oldFields[fname]; !ok {
+			severity := Additive
+			if addIsBreaking {
+				severity = Breaking
+			}
+			changes = append(changes, Change{
+				Object:   name + "." + fname,
+				Kind:     Added,
+				Severity: severity,
+				Message:  "field added to struct",
+			})
+		}
+	}
+	return changes
+}
+
+func structFields(s *types.Struct) map[string]types.Type {
+	fields := make(map[string]types.Type, s.NumFields())
+	for i := 0; i < s.NumFields(); i++ {
+		f := s.Field(i)
+		if f.Exported() {
+			fields[f.Name()] = f.Type()
+		}
+	}
+	return fields
+}
+
+func hasUnexportedField(s *types.Struct) bool {
+	for i := 0; i < s.NumFields(); i++ {
+		if !s.Field(i).Exported() {
+			return true
+		}
+	}
+	return false
+}
+
+// equivalentTypes reports whether t1 and t2 describe the same type,
+// possibly as seen by two independent type-checking runs (for example
+// the two sides of a DiffFiles comparison, each with its own
+// token.FileSet and imports map). types.Identical cannot be used for
+// this: it compares *types.Named values by pointer identity, so a
+// named type is never Identical to the "same" named type decoded in a
+// separate run, even a type referring to itself (as in a recursive
+// struct) or to another type in the very same package.
+//
+// equivalentTypes instead walks both types structurally, treating two
+// *types.Named as equivalent when they have the same package path and
+// name rather than recursing into their underlying types; this is
+// also what stops the walk from diverging on recursive types.
+func equivalentTypes(t1, t2 types.Type) bool {
+	switch a := t1.(type) {
+	case *types.Named:
+		b, ok := t2.(*types.Named)
+		return ok && namedTypeID(a) == namedTypeID(b)
+	case *types.Basic:
+		b, ok := t2.(*types.Basic)
+		return ok && a.Kind() == b.Kind()
+	case *types.Pointer:
+		b, ok := t2.(*types.Pointer)
+		return ok && equivalentTypes(a.Elem(), b.Elem())
+	case *types.Slice:
+		b, ok := t2.(*types.Slice)
+		return ok && equivalentTypes(a.Elem(), b.Elem())
+	case *types.Array:
+		b, ok := t2.(*types.Array)
+		return ok && a.Len() == b.Len() && equivalentTypes(a.Elem(), b.Elem())
+	case *types.Map:
+		b, ok := t2.(*types.Map)
+		return ok && equivalentTypes(a.Key(), b.Key()) && equivalentTypes(a.Elem(), b.Elem())
+	case *types.Chan:
+		b, ok := t2.(*types.Chan)
+		return ok && a.Dir() == b.Dir() && equivalentTypes(a.Elem(), b.Elem())
+	case *types.Signature:
+		b, ok := t2.(*types.Signature)
+		return ok && a.Variadic() == b.Variadic() &&
+			equivalentTuples(a.Params(), b.Params()) &&
+			equivalentTuples(a.Results(), b.Results())
+	case *types.Struct:
+		b, ok := t2.(*types.Struct)
+		if !ok || a.NumFields() != b.NumFields() {
+			return false
+		}
+		for i := 0; i < a.NumFields(); i++ {
+			fa, fb := a.Field(i), b.Field(i)
+			if fa.Name() != fb.Name() || fa.Embedded() != fb.Embedded() || !equivalentTypes(fa.Type(), fb.Type()) {
+				return false
+			}
+		}
+		return true
+	case *types.Interface:
+		b, ok := t2.(*types.Interface)
+		if !ok {
+			return false
+		}
+		am, bm := interfaceMethods(a), interfaceMethods(b)
+		if len(am) != len(bm) {
+			return false
+		}
+		for mname, asig := range am {
+			bsig, ok := bm[mname]
+			if !ok || !equivalentTypes(asig, bsig) {
+				return false
+			}
+		}
+		return true
+	default:
+		return types.Identical(t1, t2)
+	}
+}
+
+// equivalentTuples reports whether a and b have equivalent element
+// types, pairwise.
+func equivalentTuples(a, b *types.Tuple) bool {
+	if a.Len() != b.Len() {
+		return false
+	}
+	for i := 0; i < a.Len(); i++ {
+		if !equivalentTypes(a.At(i).Type(), b.At(i).Type()) {
+			return false
+		}
+	}
+	return true
+}
+
+// namedTypeID returns an identifier for n that is stable across
+// independent type-checking runs: its package path and name, or just
+// its name for a universe-scope type such as error.
+func namedTypeID(n *types.Named) string {
+	if pkg := n.Obj().Pkg(); pkg != nil {
+		return pkg.Path() + "." + n.Obj().Name()
+	}
+	return n.Obj().Name()
+}
+
+func kindChanged(name string, oldObj, newObj types.Object) Change {
+	return Change{
+		Object:   name,
+		Kind:     Changed,
+		Severity: Breaking,
+		Message:  fmt.Sprintf("changed from %s to %s", describe(oldObj), describe(newObj)),
+	}
+}
+
+func describe(obj types.Object) string {
+	switch obj.(type) {
+	case *types.Func:
+		return "func"
+	case *types.TypeName:
+		return "type"
+	case *types.Const:
+		return "const"
+	case *types.Var:
+		return "var"
+	default:
+		return "identifier"
+	}
+}
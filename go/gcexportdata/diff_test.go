@@ -0,0 +1,134 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcexportdata
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+// typecheck type-checks src as the body of a standalone package named
+// "p" and returns the resulting package. Each call uses its own
+// FileSet and Importer, so two packages produced from identical
+// source are, as with two independently decoded export data files,
+// never types.Identical to one another.
+func typecheck(t *testing.T, src string) *types.Package {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", "package p\n"+src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: importer.Default()}
+	pkg, err := conf.Check("p", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
+
+func TestDiffSelfIsEmpty(t *testing.T) {
+	const src = `
+type List struct {
+	Val  int
+	Next *List
+}
+
+func (l *List) Len() int { return 0 }
+
+type Greeter interface {
+	Greet(name string) string
+}
+
+func F(x int) string { return "" }
+
+const C = 42
+
+var V = 1
+`
+	old := typecheck(t, src)
+	new := typecheck(t, src)
+	if changes := Diff(old, new); len(changes) != 0 {
+		t.Errorf("Diff(old, old) = %v, want no changes", changes)
+	}
+}
+
+func TestDiffSignatureChangeIsBreaking(t *testing.T) {
+	old := typecheck(t, `func F(x int) string { return "" }`)
+	new := typecheck(t, `func F(x int) int { return 0 }`)
+
+	changes := Diff(old, new)
+	var found bool
+	for _, c := range changes {
+		if c.Object == "F" && c.Kind == Changed && c.Severity == Breaking {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Diff(old, new) = %v, want a breaking change for F", changes)
+	}
+}
+
+func TestDiffMethodRemovedIsBreaking(t *testing.T) {
+	old := typecheck(t, `
+type T struct{}
+func (T) M() int { return 0 }
+`)
+	new := typecheck(t, `
+type T struct{}
+`)
+
+	changes := Diff(old, new)
+	var found bool
+	for _, c := range changes {
+		if c.Object == "T.M" && c.Kind == Removed && c.Severity == Breaking {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Diff(old, new) = %v, want a breaking removal of T.M", changes)
+	}
+}
+
+func TestDiffMethodAddedIsAdditive(t *testing.T) {
+	old := typecheck(t, `
+type T struct{}
+`)
+	new := typecheck(t, `
+type T struct{}
+func (T) M() int { return 0 }
+`)
+
+	changes := Diff(old, new)
+	var found bool
+	for _, c := range changes {
+		if c.Object == "T.M" && c.Kind == Added && c.Severity == Additive {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Diff(old, new) = %v, want an additive addition of T.M", changes)
+	}
+}
+
+func TestDiffConstValueChangeIsBreaking(t *testing.T) {
+	old := typecheck(t, `const C = 42`)
+	new := typecheck(t, `const C = 43`)
+
+	changes := Diff(old, new)
+	var found bool
+	for _, c := range changes {
+		if c.Object == "C" && c.Kind == Changed && c.Severity == Breaking {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Diff(old, new) = %v, want a breaking value change for C", changes)
+	}
+}
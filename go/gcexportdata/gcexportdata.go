@@ -25,6 +25,7 @@ package gcexportdata // import "golang.org/x/tools/go/gcexportdata"
 
 import (
 	"bufio"
+	"encoding/binary"
 	"fmt"
 	"go/token"
 	"go/types"
@@ -83,6 +84,200 @@ func Read(in io.Reader, fset *token.FileSet, imports map[string]*types.Package,
 // Write writes encoded type information for the specified package to out.
 // The FileSet provides file position information for named objects.
 func Write(out io.Writer, fset *token.FileSet, pkg *types.Package) error {
-	_, err := out.Write(gcimporter.BExportData(fset, pkg))
+	_, err := WriteTo(out, fset, pkg)
 	return err
 }
+
+// WriteTo writes encoded type information for the specified package to
+// out, returning the number of bytes written.  The FileSet provides file
+// position information for named objects.
+//
+// WriteTo writes out the package's encoding as a single io.Writer.Write
+// call as soon as gcimporter.BExportData has produced it; Write is
+// WriteTo without the byte count. A caller writing many packages in
+// sequence therefore holds no more than one package's encoding in
+// memory once it has moved on to the next package.
+//
+// TODO(zxp01): this is not true incremental streaming: within a single
+// package, WriteTo still depends on gcimporter.BExportData building
+// that package's entire encoding in memory before WriteTo can write
+// any of it, so the per-package memory high-water mark is unchanged
+// from Write. Only a BExportDataTo entry point in
+// golang.org/x/tools/go/gcimporter15, which is not part of this tree,
+// could avoid that.
+func WriteTo(out io.Writer, fset *token.FileSet, pkg *types.Package) (int64, error) {
+	n, err := out.Write(gcimporter.BExportData(fset, pkg))
+	return int64(n), err
+}
+
+// A Writer accumulates one or more packages into a single stream,
+// framing each with a length prefix and its import path so that a
+// reader can pull the packages back apart without a side-channel
+// manifest file. A Writer is the building block for archives that hold
+// export data for an entire build graph; see ReadBundle for the
+// matching reader.
+type Writer struct {
+	out  io.Writer
+	fset *token.FileSet
+}
+
+// NewWriter returns a Writer that frames packages written to it via
+// WritePackage onto out. Close must be called when done, even though
+// the current implementation has nothing left to flush, so that
+// callers don't need to change if a future version buffers output.
+func NewWriter(out io.Writer, fset *token.FileSet) *Writer {
+	return &Writer{out: out, fset: fset}
+}
+
+// WritePackage writes pkg to the stream managed by w, framed with its
+// import path and the length of its encoding.
+func (w *Writer) WritePackage(pkg *types.Package) error {
+	data := gcimporter.BExportData(w.fset, pkg)
+	if err := writeFrame(w.out, pkg.Path(), data); err != nil {
+		return fmt.Errorf("writing export data for %q: %v", pkg.Path(), err)
+	}
+	return nil
+}
+
+// Close is a no-op: Writer writes each frame eagerly as WritePackage
+// is called.
+func (w *Writer) Close() error {
+	return nil
+}
+
+// writeFrame writes a single length-prefixed, path-tagged chunk of
+// encoded export data to out. It is shared by Writer and WriteBundle.
+func writeFrame(out io.Writer, path string, data []byte) error {
+	if err := binary.Write(out, binary.LittleEndian, uint32(len(path))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(out, path); err != nil {
+		return err
+	}
+	if err := binary.Write(out, binary.LittleEndian, uint64(len(data))); err != nil {
+		return err
+	}
+	_, err := out.Write(data)
+	return err
+}
+
+// readFrame reads back a single chunk written by writeFrame, returning
+// its import path and encoded export data.
+func readFrame(in io.Reader) (path string, data []byte, err error) {
+	var pathLen uint32
+	if err := binary.Read(in, binary.LittleEndian, &pathLen); err != nil {
+		return "", nil, err
+	}
+	pathBytes := make([]byte, pathLen)
+	if _, err := io.ReadFull(in, pathBytes); err != nil {
+		return "", nil, err
+	}
+	var dataLen uint64
+	if err := binary.Read(in, binary.LittleEndian, &dataLen); err != nil {
+		return "", nil, err
+	}
+	data = make([]byte, dataLen)
+	if _, err := io.ReadFull(in, data); err != nil {
+		return "", nil, err
+	}
+	return string(pathBytes), data, nil
+}
+
+// WriteBundle writes encoded type information for the specified
+// packages to out in a single stream, so that a caller that needs to
+// persist an entire build graph's export data does not have to manage
+// one file and one manifest entry per package.
+//
+// The packages are written in dependency order (each package's
+// imports precede the package itself), so ReadBundle can resolve
+// inter-package references in a single forward pass without requiring
+// the caller to pre-populate its imports map. WriteBundle panics if
+// pkgs contains an import cycle, which cannot happen for packages
+// produced by go/types.
+//
+// WriteBundle writes the full transitive closure of pkgs, not just the
+// packages named in pkgs: this is intentional, since the point of a
+// bundle is that ReadBundle can reconstruct every package it contains
+// without the caller supplying anything beyond what's outside the
+// bundle, and that's only possible if every import each package
+// depends on to decode is present in the stream too.  A consequence is
+// that bundling a handful of packages that import much of the standard
+// library pulls all of it into the bundle as well.
+//
+// TODO(zxp01): each package in that closure is still encoded
+// independently via gcimporter.BExportData, so a token.File shared by
+// several packages in the bundle is re-serialized once per package
+// that references it; deduplicating it within the stream would require
+// a bundle-aware entry point in golang.org/x/tools/go/gcimporter15,
+// which is not part of this tree. The lack of dedup is most costly
+// exactly when the closure is large, since shared files like those
+// backing //go:generate'd packages then recur throughout the bundle.
+func WriteBundle(out io.Writer, fset *token.FileSet, pkgs []*types.Package) error {
+	w := NewWriter(out, fset)
+	for _, pkg := range topoSort(pkgs) {
+		if err := w.WritePackage(pkg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadBundle reads a bundle written by WriteBundle from in, decodes
+// it, and returns type information for the packages it contains, in
+// the order they were written (dependency order). File position
+// information is added to fset.
+//
+// ReadBundle inserts each decoded package into imports as it is read,
+// so that later packages in the bundle can resolve imports satisfied
+// by earlier ones; the caller need not pre-populate imports with
+// anything but packages from outside the bundle.
+func ReadBundle(in io.Reader, fset *token.FileSet, imports map[string]*types.Package) ([]*types.Package, error) {
+	var pkgs []*types.Package
+	for {
+		path, data, err := readFrame(in)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading bundle: %v", err)
+		}
+		_, pkg, err := gcimporter.BImportData(fset, imports, data, path)
+		if err != nil {
+			return nil, fmt.Errorf("reading export data for %q: %v", path, err)
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs, nil
+}
+
+// topoSort returns the transitive closure of pkgs ordered so that
+// each package appears after all of its imports. It panics if pkgs
+// contains an import cycle.
+func topoSort(pkgs []*types.Package) []*types.Package {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	var order []*types.Package
+	state := make(map[*types.Package]int)
+	var visit func(pkg *types.Package)
+	visit = func(pkg *types.Package) {
+		switch state[pkg] {
+		case visited:
+			return
+		case visiting:
+			panic(fmt.Sprintf("gcexportdata: import cycle detected at package %q", pkg.Path()))
+		}
+		state[pkg] = visiting
+		for _, imp := range pkg.Imports() {
+			visit(imp)
+		}
+		state[pkg] = visited
+		order = append(order, pkg)
+	}
+	for _, pkg := range pkgs {
+		visit(pkg)
+	}
+	return order
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcexportdata
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"go/types"
+	"os"
+
+	gcimporter "golang.org/x/tools/go/gcimporter15"
+)
+
+// NewImporter returns a types.ImporterFrom that locates, decodes, and
+// memoizes export data using Find and Read, sparing callers the
+// boilerplate of wiring those functions into go/types.Config.Importer
+// themselves.
+//
+// Decoded packages are memoized in two layers: within a single
+// Importer, a package is decoded at most once per process, and across
+// processes (or across Importer values sharing the same cache), a
+// package's object or archive file is parsed at most once per distinct
+// CacheKey, i.e. until that file next changes size or mtime; later
+// imports decode the cached re-encoding of the package instead. A
+// nil cache uses an in-memory Cache created with NewCache; pass the
+// result of DiskCache to persist decoded packages across runs.
+//
+// File position information for the returned packages is added to
+// fset.
+func NewImporter(fset *token.FileSet, cache Cache) types.ImporterFrom {
+	if cache == nil {
+		cache = NewCache()
+	}
+	return &cachingImporter{
+		fset:    fset,
+		cache:   cache,
+		imports: make(map[string]*types.Package),
+	}
+}
+
+type cachingImporter struct {
+	fset    *token.FileSet
+	cache   Cache
+	imports map[string]*types.Package
+}
+
+func (imp *cachingImporter) Import(path string) (*types.Package, error) {
+	return imp.ImportFrom(path, "", 0)
+}
+
+func (imp *cachingImporter) ImportFrom(path, srcDir string, mode types.ImportMode) (*types.Package, error) {
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+
+	filename, resolved := Find(path, srcDir)
+	if filename == "" {
+		return nil, fmt.Errorf("can't find import: %q", path)
+	}
+
+	if pkg, ok := imp.imports[resolved]; ok && pkg.Complete() {
+		return pkg, nil
+	}
+
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	key := CacheKey{Path: resolved, ModTime: fi.ModTime(), Size: fi.Size()}
+
+	if data, ok := imp.cache.Get(key); ok {
+		_, pkg, err := gcimporter.BImportData(imp.fset, imp.imports, data, resolved)
+		if err == nil {
+			return pkg, nil
+		}
+		// The cached bytes don't decode, e.g. a write that was
+		// interrupted mid-way ended up with a cache entry that will
+		// never decode. BImportData may have left a half-built,
+		// incomplete package in imp.imports for resolved; discard it
+		// and fall back to the object file itself, as on a cache
+		// miss, rather than failing the import permanently.
+		delete(imp.imports, resolved)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading export data for %q: %v", path, err)
+	}
+	pkg, err := Read(r, imp.fset, imp.imports, resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if _, err := WriteTo(&buf, imp.fset, pkg); err == nil {
+		imp.cache.Put(key, buf.Bytes())
+	}
+
+	return pkg, nil
+}